@@ -0,0 +1,228 @@
+package docker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// Client abstracts the Docker Engine operations the plugin needs, so the
+// Engine API implementation can be swapped for a mock in tests.
+type Client interface {
+	Pull(ctx context.Context, ref string) error
+	Tag(ctx context.Context, source, target string) error
+	Push(ctx context.Context, ref string) (digest string, err error)
+	Remove(ctx context.Context, ref string) error
+	Prune(ctx context.Context) error
+}
+
+// DockerClient talks to the Docker Engine API over /var/run/docker.sock
+// rather than shelling out to the docker CLI.
+type DockerClient struct {
+	api *client.Client
+}
+
+// NewDockerClient builds a DockerClient from the environment-configured
+// Engine API connection (DOCKER_HOST, DOCKER_API_VERSION, etc).
+func NewDockerClient() (*DockerClient, error) {
+	api, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+	return &DockerClient{api: api}, nil
+}
+
+// Pull streams `docker pull` progress to stdout via the Engine API.
+func (d *DockerClient) Pull(ctx context.Context, ref string) error {
+	rc, err := d.api.ImagePull(ctx, ref, types.ImagePullOptions{})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return displayProgress(rc)
+}
+
+// Tag retags source as target using the Engine API.
+func (d *DockerClient) Tag(ctx context.Context, source, target string) error {
+	return d.api.ImageTag(ctx, source, target)
+}
+
+// Push pushes ref and returns the digest the registry assigned it.
+func (d *DockerClient) Push(ctx context.Context, ref string) (string, error) {
+	authConfig, err := registryAuthForRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	rc, err := d.api.ImagePush(ctx, ref, types.ImagePushOptions{RegistryAuth: authConfig})
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	var digest string
+	err = jsonmessage.DisplayJSONMessagesStream(rc, os.Stdout, os.Stdout.Fd(), false, func(msg jsonmessage.JSONMessage) {
+		if msg.Aux == nil {
+			return
+		}
+		var pushResult struct {
+			Digest string `json:"Digest"`
+		}
+		if jsonErr := json.Unmarshal(*msg.Aux, &pushResult); jsonErr == nil && pushResult.Digest != "" {
+			digest = pushResult.Digest
+		}
+	})
+	return digest, err
+}
+
+// Remove removes a local image, mirroring `docker rmi`.
+func (d *DockerClient) Remove(ctx context.Context, ref string) error {
+	_, err := d.api.ImageRemove(ctx, ref, types.ImageRemoveOptions{Force: true})
+	return err
+}
+
+// Prune reclaims dangling images, like `docker image prune -f`; unlike the
+// CLI path's `docker system prune -f`, it leaves containers, networks and
+// build cache alone.
+func (d *DockerClient) Prune(ctx context.Context) error {
+	_, err := d.api.ImagesPrune(ctx, filters.NewArgs())
+	return err
+}
+
+// displayProgress streams Engine API progress messages to stdout the same
+// way the docker CLI renders them.
+func displayProgress(rc io.Reader) error {
+	return jsonmessage.DisplayJSONMessagesStream(rc, os.Stdout, os.Stdout.Fd(), false, nil)
+}
+
+// registryAuthForRef reads the auth entry commandLogin already wrote to the
+// active Docker config for ref's registry host, since ImagePush requires it
+// passed explicitly as a base64-encoded header rather than read from disk.
+func registryAuthForRef(ref string) (string, error) {
+	host := strings.SplitN(ref, "/", 2)[0]
+
+	raw, err := ioutil.ReadFile(dockerConfigDir() + "/config.json")
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return "", err
+	}
+
+	entry, ok := config.Auths[host]
+	if !ok || entry.Auth == "" {
+		return "", nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("unexpected auth entry for %s", host)
+	}
+
+	authConfig, err := json.Marshal(types.AuthConfig{
+		Username:      parts[0],
+		Password:      parts[1],
+		ServerAddress: host,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(authConfig), nil
+}
+
+// execClient runs the pull/tag/push/cleanup pipeline against the Docker
+// Engine API directly, used unless Plugin.UseCLI opts back into the CLI.
+func (p Plugin) execClient() error {
+	cli, err := NewDockerClient()
+	if err != nil {
+		return fmt.Errorf("Error connecting to the Docker Engine API: %s", err)
+	}
+	return p.execWithClient(cli)
+}
+
+// execWithClient runs the pull/tag/push/cleanup pipeline against cli,
+// split out from execClient so tests can drive it against a mock Client.
+func (p Plugin) execWithClient(cli Client) error {
+	ctx := context.Background()
+
+	source := fmt.Sprintf("%s@%s", p.Pull.Repo, p.Pull.Sha)
+	if err := cli.Pull(ctx, source); err != nil {
+		fmt.Printf("Could not pull cache-from image %s. Ignoring...\n", source)
+	}
+
+	manifest := p.wantsManifest()
+	digests := map[string]string{}
+
+	if !manifest && p.Dryrun {
+		for _, tag := range p.Tags {
+			target := fmt.Sprintf("%s/%s:%s", p.Daemon.Registry, p.Pull.Repo, tag)
+			if err := cli.Tag(ctx, source, target); err != nil {
+				return err
+			}
+		}
+	} else if !manifest {
+		// tag and push each tag concurrently across a bounded worker pool,
+		// retrying transient registry errors.
+		var err error
+		digests, err = p.pushTagsConcurrentlyClient(ctx, cli, source)
+		if err != nil {
+			return err
+		}
+	} else if p.Dryrun == false {
+		for _, tag := range p.Tags {
+			target := fmt.Sprintf("%s/%s:%s", p.Daemon.Registry, p.Pull.Repo, tag)
+			if err := pushManifestList(p.Pull, target); err != nil {
+				return err
+			}
+		}
+	}
+
+	// fan the pulled image out to any additional destination registries,
+	// before Cleanup can remove the local source image retagging depends on.
+	if len(p.Destinations) > 0 {
+		if err := p.pushDestinations(); err != nil {
+			return err
+		}
+	}
+
+	if p.Sign.isConfigured() && p.Dryrun == false {
+		if err := p.signPushedTags(digests); err != nil {
+			return err
+		}
+	}
+
+	// purge the local image only once Destinations and Sign have finished
+	// using it.
+	if p.Cleanup {
+		if err := cli.Remove(ctx, source); err != nil {
+			return err
+		}
+		if err := cli.Prune(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// mockClient is an in-memory Client used to verify execWithClient's
+// tag/push/cleanup sequencing without a real Docker Engine.
+type mockClient struct {
+	mu seq
+
+	pullCalls []string
+	tagSeq    map[string]int
+	pushSeq   map[string]int
+	removed   []string
+	pruneSeq  int
+}
+
+// seq is a mutex-guarded monotonic counter used to record the relative
+// order calls into mockClient happened in.
+type seq struct {
+	sync.Mutex
+	n int
+}
+
+func (s *seq) next() int {
+	s.Lock()
+	defer s.Unlock()
+	s.n++
+	return s.n
+}
+
+func newMockClient() *mockClient {
+	return &mockClient{
+		tagSeq:  map[string]int{},
+		pushSeq: map[string]int{},
+	}
+}
+
+func (m *mockClient) Pull(ctx context.Context, ref string) error {
+	m.mu.next()
+	m.pullCalls = append(m.pullCalls, ref)
+	return nil
+}
+
+func (m *mockClient) Tag(ctx context.Context, source, target string) error {
+	n := m.mu.next()
+	m.mu.Lock()
+	m.tagSeq[target] = n
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *mockClient) Push(ctx context.Context, ref string) (string, error) {
+	n := m.mu.next()
+	m.mu.Lock()
+	m.pushSeq[ref] = n
+	m.mu.Unlock()
+	return "sha256:" + ref, nil
+}
+
+func (m *mockClient) Remove(ctx context.Context, ref string) error {
+	m.mu.next()
+	m.mu.Lock()
+	m.removed = append(m.removed, ref)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *mockClient) Prune(ctx context.Context) error {
+	m.pruneSeq = m.mu.next()
+	return nil
+}
+
+func TestExecWithClientTagsPushesThenCleansUp(t *testing.T) {
+	p := Plugin{
+		Pull:    Pull{Repo: "org/app", Sha: "sha256:abc123"},
+		Daemon:  Daemon{Registry: "registry.example.com"},
+		Tags:    []string{"latest", "1.0", "1.0.1"},
+		Cleanup: true,
+	}
+
+	cli := newMockClient()
+	if err := p.execWithClient(cli); err != nil {
+		t.Fatalf("execWithClient returned an error: %s", err)
+	}
+
+	source := fmt.Sprintf("%s@%s", p.Pull.Repo, p.Pull.Sha)
+	if len(cli.pullCalls) != 1 || cli.pullCalls[0] != source {
+		t.Fatalf("expected a single pull of %s, got %v", source, cli.pullCalls)
+	}
+
+	for _, tag := range p.Tags {
+		target := fmt.Sprintf("%s/%s:%s", p.Daemon.Registry, p.Pull.Repo, tag)
+
+		tagSeq, ok := cli.tagSeq[target]
+		if !ok {
+			t.Fatalf("tag %s was never tagged", target)
+		}
+		pushSeq, ok := cli.pushSeq[target]
+		if !ok {
+			t.Fatalf("tag %s was never pushed", target)
+		}
+		if tagSeq >= pushSeq {
+			t.Fatalf("tag %s was pushed (seq %d) before it was tagged (seq %d)", target, pushSeq, tagSeq)
+		}
+		if pushSeq >= cli.pruneSeq {
+			t.Fatalf("tag %s was pushed (seq %d) after cleanup pruned (seq %d)", target, pushSeq, cli.pruneSeq)
+		}
+	}
+
+	if len(cli.removed) != 1 || cli.removed[0] != source {
+		t.Fatalf("expected cleanup to remove %s, got %v", source, cli.removed)
+	}
+}
+
+func TestExecWithClientDryrunSkipsPush(t *testing.T) {
+	p := Plugin{
+		Pull:   Pull{Repo: "org/app", Sha: "sha256:abc123"},
+		Daemon: Daemon{Registry: "registry.example.com"},
+		Tags:   []string{"latest"},
+		Dryrun: true,
+	}
+
+	cli := newMockClient()
+	if err := p.execWithClient(cli); err != nil {
+		t.Fatalf("execWithClient returned an error: %s", err)
+	}
+
+	target := fmt.Sprintf("%s/%s:%s", p.Daemon.Registry, p.Pull.Repo, p.Tags[0])
+	if _, ok := cli.tagSeq[target]; !ok {
+		t.Fatalf("expected %s to still be tagged on a dryrun", target)
+	}
+	if len(cli.pushSeq) != 0 {
+		t.Fatalf("expected no pushes on a dryrun, got %v", cli.pushSeq)
+	}
+}
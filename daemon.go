@@ -0,0 +1,18 @@
+package docker
+
+import "os"
+
+const (
+	dockerExe  = "/usr/local/bin/docker"
+	dockerdExe = "/usr/local/bin/dockerd"
+)
+
+// startDaemon starts the Docker daemon server in the background.
+func (p Plugin) startDaemon() {
+	cmd := commandDaemon(p.Daemon)
+	if p.Daemon.Debug {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	}
+	go cmd.Run()
+}
@@ -1,13 +1,18 @@
 package docker
 
 import (
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"strings"
 	"time"
 )
 
+// cosignExe is the cosign binary invoked for signing and SBOM attachment.
+const cosignExe = "cosign"
+
 type (
 	// Daemon defines Docker daemon parameters.
 	Daemon struct {
@@ -32,6 +37,13 @@ type (
 		Username string // Docker registry username
 		Password string // Docker registry password
 		Email    string // Docker registry email
+		Config   string // Docker json dockerconfig content
+
+		AWSRegion          string // AWS region the ECR registry lives in
+		AWSAccessKeyID     string // AWS access key used to mint an ECR token
+		AWSSecretAccessKey string // AWS secret key used to mint an ECR token
+		AWSRoleARN         string // Role to assume before minting an ECR token, for cross-account ECR
+		AWSExternalID      string // External ID required by the target role's trust policy
 	}
 
 	Pull struct {
@@ -39,6 +51,25 @@ type (
 		Sha			string		// Dockerhub SHA
 	}
 
+	// Destination defines an additional registry to mirror the pulled
+	// image to, each with its own authentication and tag set.
+	Destination struct {
+		Registry string   // Destination registry address
+		Repo     string   // Destination repository
+		Tags     []string // Destination tags
+		Login    Login    // Destination registry login
+	}
+
+	// Sign defines cosign signing parameters applied to every tag pushed
+	// by the plugin.
+	Sign struct {
+		KeyPath  string // Path to a cosign private key on disk
+		KeyEnv   string // Name of an env var holding a base64-encoded cosign private key
+		Password string // Password for the cosign private key
+		Keyless  bool   // Sign keylessly via Fulcio/OIDC instead of a private key
+		SBOMPath string // Path to a pre-generated SPDX/CycloneDX SBOM to attach
+	}
+
 	// Build defines Docker build parameters.
 	Build struct {
 		Remote      string   // Git remote URL
@@ -62,12 +93,21 @@ type (
 
 	// Plugin defines the Docker plugin parameters.
 	Plugin struct {
-		Login   Login  // Docker login configuration
-		Pull    Pull  // Docker build configuration
-		Daemon  Daemon // Docker daemon configuration
-		Dryrun  bool   // Docker push is skipped
-		Cleanup bool   // Docker purge is enabled
-		Tags 	[]string	// Docker Tags
+		Login        Login         // Docker login configuration
+		Pull         Pull          // Docker pull configuration
+		Daemon       Daemon        // Docker daemon configuration
+		Dryrun       bool          // Docker push is skipped
+		Cleanup      bool          // Docker purge is enabled
+		Tags         []string      // Docker Tags
+		Destinations []Destination // Additional registries to mirror the pulled image to
+		Manifest     bool          // Preserve the source OCI index when pushing (buildx imagetools / docker manifest)
+		Platforms    []string      // Platforms expected in the source manifest list, e.g. linux/amd64,linux/arm64
+		Sign         Sign          // Cosign signing configuration
+		UseCLI       bool          // Shell out to the docker CLI instead of talking to the Engine API directly
+		CreateRepo   bool          // Auto-create the destination ECR repository if it does not exist
+		Parallelism  int           // Number of tags pushed concurrently, default 4
+		MaxRetries   int           // Number of retries for a transient push failure
+		RetryBackoff time.Duration // Base delay between retries, doubled on each attempt
 	}
 )
 
@@ -89,36 +129,63 @@ func (p Plugin) Exec() error {
 		time.Sleep(time.Second * 1)
 	}
 
+	// mint a fresh ECR authorization token in place of a pre-supplied
+	// password when promoting into an ECR registry, but only when AWS
+	// credentials were actually supplied for it; otherwise leave a
+	// pre-computed Login.Username/Password alone.
+	if isECRRegistry(p.Login.Registry) && wantsECRAutoAuth(p.Login) {
+		login, err := ecrLogin(p.Login)
+		if err != nil {
+			return fmt.Errorf("Error minting ECR token: %s", err)
+		}
+		p.Login = login
+
+		if p.CreateRepo {
+			if err := createECRRepo(p.Login, p.Pull.Repo); err != nil {
+				return fmt.Errorf("Error creating ECR repository: %s", err)
+			}
+		}
+
+		stop := startECRTokenRefresher(p.Login)
+		defer close(stop)
+	}
+
 	// login to the Docker registry
 	if p.Login.Password != "" {
-		cmd := commandLogin(p.Login)
-		err := cmd.Run()
+		cmd, err := commandLogin(p.Login)
 		if err != nil {
 			return fmt.Errorf("Error authenticating: %s", err)
 		}
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("Error authenticating: %s", err)
+		}
 	} else {
 		fmt.Println("Registry credentials not provided. Guest mode enabled.")
 	}
 
+	if p.UseCLI {
+		return p.execCLI()
+	}
+	return p.execClient()
+}
+
+// execCLI runs the pull/tag/push/cleanup pipeline by shelling out to the
+// docker CLI, preserved for operators who depend on its exact behavior.
+func (p Plugin) execCLI() error {
 	var cmds []*exec.Cmd
 	cmds = append(cmds, commandVersion()) // docker version
 	cmds = append(cmds, commandInfo())    // docker info
 
 	cmds = append(cmds, commandPull(p.Pull)) // docker pull
 
-	for _, tag := range p.Tags {
-		cmds = append(cmds, commandTag(p.Pull, tag, p.Daemon.Registry)) // docker tag
+	manifest := p.wantsManifest()
 
-		if p.Dryrun == false {
-			cmds = append(cmds, commandPush(p.Pull, tag, p.Daemon.Registry)) // docker push
+	if !manifest {
+		for _, tag := range p.Tags {
+			cmds = append(cmds, commandTag(p.Pull, tag, p.Daemon.Registry)) // docker tag
 		}
 	}
 
-	if p.Cleanup {
-		cmds = append(cmds, commandRmi(p.Pull)) // docker rmi
-		cmds = append(cmds, commandPrune())           // docker system prune -f
-	}
-
 	// execute all commands in batch mode.
 	for _, cmd := range cmds {
 		cmd.Stdout = os.Stdout
@@ -133,13 +200,320 @@ func (p Plugin) Exec() error {
 		}
 	}
 
+	// once every tag has been created, push them concurrently across a
+	// bounded worker pool, retrying transient registry errors.
+	if !manifest && p.Dryrun == false {
+		if err := p.pushTagsConcurrently(p.Tags); err != nil {
+			return err
+		}
+	}
+
+	// push with the multi-platform manifest list preserved, since the
+	// simple tag/push path above was skipped for a manifest-list source.
+	if manifest && p.Dryrun == false {
+		for _, tag := range p.Tags {
+			target := fmt.Sprintf("%s/%s:%s", p.Daemon.Registry, p.Pull.Repo, tag)
+			if err := pushManifestList(p.Pull, target); err != nil {
+				return err
+			}
+		}
+	}
+
+	// fan the pulled image out to any additional destination registries,
+	// before Cleanup can remove the local source image retagging depends on.
+	if len(p.Destinations) > 0 {
+		if err := p.pushDestinations(); err != nil {
+			return err
+		}
+	}
+
+	// sign every tag pushed to the primary destination registry.
+	if p.Sign.isConfigured() && p.Dryrun == false {
+		if err := p.signPushedTags(nil); err != nil {
+			return err
+		}
+	}
+
+	// purge the local image only once Destinations and Sign have finished
+	// using it.
+	if p.Cleanup {
+		rmiCmd := commandRmi(p.Pull)
+		rmiCmd.Stdout = os.Stdout
+		rmiCmd.Stderr = os.Stderr
+		trace(rmiCmd)
+		if err := rmiCmd.Run(); err != nil {
+			return err
+		}
+
+		pruneCmd := commandPrune()
+		pruneCmd.Stdout = os.Stdout
+		pruneCmd.Stderr = os.Stderr
+		trace(pruneCmd)
+		if err := pruneCmd.Run(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// isConfigured reports whether signing was requested.
+func (s Sign) isConfigured() bool {
+	return s.KeyPath != "" || s.KeyEnv != "" || s.Keyless
+}
+
+// signPushedTags invokes cosign against each pushed tag, attaching an SBOM
+// when one is configured. digests carries the digest the registry returned
+// for a tag when the caller already knows it (e.g. execClient reading it
+// straight off ImagePush); a tag missing from digests falls back to
+// resolving it via the docker CLI.
+func (p Plugin) signPushedTags(digests map[string]string) error {
+	keyPath, cleanupKey, err := resolveSignKeyPath(p.Sign)
+	if err != nil {
+		return fmt.Errorf("Error preparing cosign sign: %s", err)
+	}
+	defer cleanupKey()
+
+	for _, tag := range p.Tags {
+		target := fmt.Sprintf("%s/%s:%s", p.Daemon.Registry, p.Pull.Repo, tag)
+
+		digest, ok := digests[tag]
+		if !ok {
+			var err error
+			digest, err = resolveDigest(target)
+			if err != nil {
+				return fmt.Errorf("Error resolving digest for %s: %s", target, err)
+			}
+		}
+		ref := fmt.Sprintf("%s@%s", target, digest)
+
+		cmd := commandCosignSign(p.Sign, keyPath, ref)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		trace(cmd)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("Error signing %s: %s", ref, err)
+		}
+
+		if p.Sign.SBOMPath != "" {
+			sbomCmd := commandCosignAttachSBOM(p.Sign, ref)
+			sbomCmd.Stdout = os.Stdout
+			sbomCmd.Stderr = os.Stderr
+			trace(sbomCmd)
+			if err := sbomCmd.Run(); err != nil {
+				return fmt.Errorf("Error attaching sbom to %s: %s", ref, err)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveDigest returns the immutable digest of a freshly pushed tag, first
+// trying a plain image inspect and falling back to buildx imagetools for
+// manifest-list references.
+func resolveDigest(target string) (string, error) {
+	cmd := exec.Command(dockerExe, "inspect", "--format", "{{index .RepoDigests 0}}", target)
+	out, err := cmd.Output()
+	if err != nil {
+		cmd = exec.Command(dockerExe, "buildx", "imagetools", "inspect", target, "--format", "{{.Manifest.Digest}}")
+		out, err = cmd.Output()
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	ref := strings.TrimSpace(string(out))
+	parts := strings.SplitN(ref, "@", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("unexpected digest reference %q", ref)
+	}
+	return parts[1], nil
+}
+
+// resolveSignKeyPath resolves the cosign private key path once for an
+// entire run, decoding Sign.KeyEnv to a single temp file when set so that
+// signing N tags doesn't leave N plaintext copies of the key on disk. The
+// returned cleanup func removes that temp file (a no-op otherwise) and
+// must be called exactly once, after every tag has been signed.
+func resolveSignKeyPath(sign Sign) (string, func(), error) {
+	noop := func() {}
+	if sign.Keyless || sign.KeyEnv == "" {
+		return sign.KeyPath, noop, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(os.Getenv(sign.KeyEnv))
+	if err != nil {
+		return "", noop, fmt.Errorf("decoding %s: %s", sign.KeyEnv, err)
+	}
+	f, err := ioutil.TempFile("", "cosign-*.key")
+	if err != nil {
+		return "", noop, err
+	}
+	if _, err := f.Write(decoded); err != nil {
+		f.Close()
+		return "", noop, err
+	}
+	f.Close()
+	return f.Name(), func() { os.Remove(f.Name()) }, nil
+}
+
+// helper function to create the cosign sign command against an
+// already-resolved keyPath (see resolveSignKeyPath).
+func commandCosignSign(sign Sign, keyPath string, ref string) *exec.Cmd {
+	args := []string{"sign"}
+	env := os.Environ()
+	if sign.Password != "" {
+		env = append(env, "COSIGN_PASSWORD="+sign.Password)
+	}
+
+	if sign.Keyless {
+		env = append(env, "COSIGN_EXPERIMENTAL=1")
+		args = append(args, ref)
+	} else {
+		args = append(args, "--key", keyPath, ref)
+	}
+
+	cmd := exec.Command(cosignExe, args...)
+	cmd.Env = env
+	return cmd
+}
+
+// helper function to create the cosign attach sbom command.
+func commandCosignAttachSBOM(sign Sign, ref string) *exec.Cmd {
+	return exec.Command(cosignExe, "attach", "sbom", "--sbom", sign.SBOMPath, ref)
+}
+
+// pushDestinations logs into and retags/pushes the pulled image to every
+// configured destination registry, signing each pushed tag when Sign is
+// configured, and returns a single consolidated error describing every
+// destination that failed to push or sign.
+func (p Plugin) pushDestinations() error {
+	var failures []string
+
+	var keyPath string
+	if p.Sign.isConfigured() && !p.Dryrun {
+		var (
+			cleanupKey func()
+			err        error
+		)
+		keyPath, cleanupKey, err = resolveSignKeyPath(p.Sign)
+		if err != nil {
+			return fmt.Errorf("Error preparing cosign sign: %s", err)
+		}
+		defer cleanupKey()
+	}
+
+	for i, dest := range p.Destinations {
+		configDir, err := destinationDockerConfig(i)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", dest.Registry, err))
+			continue
+		}
+		defer os.RemoveAll(configDir)
+
+		if dest.Login.Config != "" {
+			if err := writeDockerConfig(configDir, dest.Login.Config); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: authenticating: %s", dest.Registry, err))
+				continue
+			}
+		} else if dest.Login.Password != "" {
+			cmd, err := commandLogin(dest.Login)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s: authenticating: %s", dest.Registry, err))
+				continue
+			}
+			cmd.Env = append(os.Environ(), "DOCKER_CONFIG="+configDir)
+			trace(cmd)
+			if err := cmd.Run(); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: authenticating: %s", dest.Registry, err))
+				continue
+			}
+		}
+
+		for _, tag := range dest.Tags {
+			tagCmd := commandTagDest(p.Pull, dest, tag)
+			trace(tagCmd)
+			if err := tagCmd.Run(); err != nil {
+				failures = append(failures, fmt.Sprintf("%s:%s: tagging: %s", dest.Registry, tag, err))
+				continue
+			}
+
+			if p.Dryrun {
+				continue
+			}
+
+			pushCmd := commandPushDest(dest, tag)
+			pushCmd.Env = append(os.Environ(), "DOCKER_CONFIG="+configDir)
+			pushCmd.Stdout = os.Stdout
+			pushCmd.Stderr = os.Stderr
+			trace(pushCmd)
+			if err := pushCmd.Run(); err != nil {
+				failures = append(failures, fmt.Sprintf("%s:%s: %s", dest.Registry, tag, err))
+				continue
+			}
+
+			if p.Sign.isConfigured() {
+				if err := p.signDestinationTag(dest, tag, configDir, keyPath); err != nil {
+					failures = append(failures, fmt.Sprintf("%s:%s: %s", dest.Registry, tag, err))
+				}
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("Error pushing to destinations:\n%s", strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+// signDestinationTag signs the tag just pushed to dest, authenticating
+// through dest's isolated configDir (still valid here; pushDestinations'
+// os.RemoveAll(configDir) only fires once the whole function returns).
+func (p Plugin) signDestinationTag(dest Destination, tag string, configDir string, keyPath string) error {
+	target := fmt.Sprintf("%s/%s:%s", dest.Registry, dest.Repo, tag)
+	digest, err := resolveDigest(target)
+	if err != nil {
+		return fmt.Errorf("resolving digest for %s: %s", target, err)
+	}
+	ref := fmt.Sprintf("%s@%s", target, digest)
+
+	cmd := commandCosignSign(p.Sign, keyPath, ref)
+	cmd.Env = append(cmd.Env, "DOCKER_CONFIG="+configDir)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	trace(cmd)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("signing %s: %s", ref, err)
+	}
+
+	if p.Sign.SBOMPath != "" {
+		sbomCmd := commandCosignAttachSBOM(p.Sign, ref)
+		sbomCmd.Env = append(os.Environ(), "DOCKER_CONFIG="+configDir)
+		sbomCmd.Stdout = os.Stdout
+		sbomCmd.Stderr = os.Stderr
+		trace(sbomCmd)
+		if err := sbomCmd.Run(); err != nil {
+			return fmt.Errorf("attaching sbom to %s: %s", ref, err)
+		}
+	}
+	return nil
+}
+
+// destinationDockerConfig creates an isolated DOCKER_CONFIG directory so
+// logging into multiple destination registries does not clobber a single
+// shared ~/.docker/config.json.
+func destinationDockerConfig(i int) (string, error) {
+	return os.MkdirTemp("", fmt.Sprintf("docker-dest-%d-", i))
+}
+
 // helper function to create the docker login command.
-func commandLogin(login Login) *exec.Cmd {
+func commandLogin(login Login) (*exec.Cmd, error) {
+	if login.Config != "" {
+		return commandLoginConfig(login)
+	}
 	if login.Email != "" {
-		return commandLoginEmail(login)
+		return commandLoginEmail(login), nil
 	}
 	cmd := exec.Command(
 		dockerExe, "login",
@@ -148,7 +522,36 @@ func commandLogin(login Login) *exec.Cmd {
 		login.Registry,
 	)
 	cmd.Stdin = strings.NewReader(login.Password)
-	return cmd
+	return cmd, nil
+}
+
+// helper function to write a raw dockercfg json blob to the active
+// DOCKER_CONFIG directory in lieu of running `docker login`.
+func commandLoginConfig(login Login) (*exec.Cmd, error) {
+	if err := writeDockerConfig(dockerConfigDir(), login.Config); err != nil {
+		return nil, err
+	}
+	return exec.Command(dockerExe, "version"), nil
+}
+
+// writeDockerConfig writes a raw dockercfg json blob to configDir, used in
+// place of running `docker login` for both the primary registry and, with
+// an explicit per-destination configDir, additional destination registries.
+func writeDockerConfig(configDir string, config string) error {
+	if err := os.MkdirAll(configDir, 0600); err != nil {
+		return err
+	}
+	path := fmt.Sprintf("%s/config.json", configDir)
+	return ioutil.WriteFile(path, []byte(config), 0600)
+}
+
+// dockerConfigDir returns the DOCKER_CONFIG directory currently set in the
+// environment, falling back to the default ~/.docker location.
+func dockerConfigDir() string {
+	if config := os.Getenv("DOCKER_CONFIG"); config != "" {
+		return config
+	}
+	return "/root/.docker"
 }
 
 // helper to check if args match "docker pull <image>"
@@ -304,6 +707,98 @@ func commandPush(pull Pull, tag string, registry string) *exec.Cmd {
 	return exec.Command(dockerExe, "push", target)
 }
 
+// helper function to create the docker tag command for a destination registry.
+func commandTagDest(pull Pull, dest Destination, tag string) *exec.Cmd {
+	var (
+		source = fmt.Sprintf("%s@%s", pull.Repo, pull.Sha)
+		target = fmt.Sprintf("%s/%s:%s", dest.Registry, dest.Repo, tag)
+	)
+	return exec.Command(
+		dockerExe, "tag", source, target,
+	)
+}
+
+// helper function to create the docker push command for a destination registry.
+func commandPushDest(dest Destination, tag string) *exec.Cmd {
+	target := fmt.Sprintf("%s/%s:%s", dest.Registry, dest.Repo, tag)
+	return exec.Command(dockerExe, "push", target)
+}
+
+// wantsManifest reports whether the manifest-preserving push path should be
+// used, opted into via either Plugin.Manifest or a non-empty
+// Plugin.Platforms, and confirmed by inspecting the actual source image.
+func (p Plugin) wantsManifest() bool {
+	if !p.Manifest && len(p.Platforms) == 0 {
+		return false
+	}
+	return isMultiPlatform(p.Pull)
+}
+
+// isMultiPlatform inspects the pulled source image via `docker buildx
+// imagetools inspect` and reports whether it is a multi-platform OCI index
+// rather than a single-platform image.
+func isMultiPlatform(pull Pull) bool {
+	cmd := commandImagetoolsInspect(pull)
+	out, err := cmd.Output()
+	if err != nil {
+		return false
+	}
+	return strings.Count(string(out), "Platform:") > 1
+}
+
+// helper function to create the buildx imagetools inspect command.
+func commandImagetoolsInspect(pull Pull) *exec.Cmd {
+	source := fmt.Sprintf("%s@%s", pull.Repo, pull.Sha)
+	return exec.Command(dockerExe, "buildx", "imagetools", "inspect", source)
+}
+
+// pushManifestList re-publishes the pulled source under target, preserving
+// the full OCI index, using buildx imagetools and falling back to
+// `docker manifest create`/`push` if buildx is unavailable.
+func pushManifestList(pull Pull, target string) error {
+	source := fmt.Sprintf("%s@%s", pull.Repo, pull.Sha)
+
+	cmd := commandImagetoolsCreate(source, target)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	trace(cmd)
+	if err := cmd.Run(); err == nil {
+		return nil
+	}
+
+	fmt.Println("buildx imagetools create failed, falling back to docker manifest")
+
+	createCmd := commandManifestCreate(source, target)
+	trace(createCmd)
+	if err := createCmd.Run(); err != nil {
+		return fmt.Errorf("Error creating manifest list: %s", err)
+	}
+
+	pushCmd := commandManifestPush(target)
+	pushCmd.Stdout = os.Stdout
+	pushCmd.Stderr = os.Stderr
+	trace(pushCmd)
+	if err := pushCmd.Run(); err != nil {
+		return fmt.Errorf("Error pushing manifest list: %s", err)
+	}
+	return nil
+}
+
+// helper function to create the buildx imagetools create command.
+func commandImagetoolsCreate(source, target string) *exec.Cmd {
+	return exec.Command(dockerExe, "buildx", "imagetools", "create", "--tag", target, source)
+}
+
+// helper function to create the docker manifest create command.
+func commandManifestCreate(source, target string) *exec.Cmd {
+	return exec.Command(dockerExe, "manifest", "create", target, source)
+}
+
+// helper function to create the docker manifest push command.
+func commandManifestPush(target string) *exec.Cmd {
+	return exec.Command(dockerExe, "manifest", "push", target)
+}
+
 // helper function to create the docker daemon command.
 func commandDaemon(daemon Daemon) *exec.Cmd {
 	args := []string{"--data-root", daemon.StoragePath}
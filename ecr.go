@@ -0,0 +1,163 @@
+package docker
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// ecrRegistryPattern matches an ECR registry host, e.g.
+// 123456789012.dkr.ecr.eu-west-1.amazonaws.com.
+var ecrRegistryPattern = regexp.MustCompile(`^\d+\.dkr\.ecr\.[a-z0-9-]+\.amazonaws\.com$`)
+
+// ecrTokenRefreshInterval is how often a long-running batch promotion
+// re-authenticates against ECR, comfortably inside the token's 12h lifetime.
+const ecrTokenRefreshInterval = 11 * time.Hour
+
+// isECRRegistry reports whether registry is an ECR registry host.
+func isECRRegistry(registry string) bool {
+	return ecrRegistryPattern.MatchString(registry)
+}
+
+// wantsECRAutoAuth reports whether login carries AWS credentials to mint a
+// fresh ECR token with. Callers who already pre-computed
+// Login.Username/Password themselves (e.g. via `aws ecr get-login-password`)
+// leave these unset, and must not have that password silently overridden by
+// a token minted from whatever AWS credentials happen to be ambient.
+func wantsECRAutoAuth(login Login) bool {
+	return login.AWSAccessKeyID != "" || login.AWSRoleARN != ""
+}
+
+// ecrLogin mints a fresh ECR authorization token and returns login updated
+// with the username/password docker login expects, so callers don't have
+// to pre-compute `aws ecr get-login-password`.
+func ecrLogin(login Login) (Login, error) {
+	token, err := ecrAuthToken(login)
+	if err != nil {
+		return login, err
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return login, fmt.Errorf("decoding ECR authorization token: %s", err)
+	}
+
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return login, fmt.Errorf("unexpected ECR authorization token format")
+	}
+
+	login.Username = parts[0]
+	login.Password = parts[1]
+	return login, nil
+}
+
+// ecrAuthToken calls ecr.GetAuthorizationToken, assuming AWSRoleARN first
+// when one is configured for cross-account ECR access.
+func ecrAuthToken(login Login) (string, error) {
+	svc, err := ecrClient(login)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := svc.GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return "", err
+	}
+	if len(out.AuthorizationData) == 0 {
+		return "", fmt.Errorf("no ECR authorization data returned")
+	}
+	return aws.StringValue(out.AuthorizationData[0].AuthorizationToken), nil
+}
+
+// ecrClient builds an ECR service client from login's static credentials
+// (falling back to the default provider chain) and, when AWSRoleARN is
+// set, assumes that role first.
+func ecrClient(login Login) (*ecr.ECR, error) {
+	cfg := aws.NewConfig().WithRegion(login.AWSRegion)
+	if login.AWSAccessKeyID != "" {
+		cfg = cfg.WithCredentials(credentials.NewStaticCredentials(
+			login.AWSAccessKeyID, login.AWSSecretAccessKey, "",
+		))
+	}
+
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if login.AWSRoleARN != "" {
+		roleCreds := stscreds.NewCredentials(sess, login.AWSRoleARN, func(p *stscreds.AssumeRoleProvider) {
+			if login.AWSExternalID != "" {
+				p.ExternalID = aws.String(login.AWSExternalID)
+			}
+		})
+		cfg = cfg.WithCredentials(roleCreds)
+	}
+
+	return ecr.New(sess, cfg), nil
+}
+
+// createECRRepo creates repo if it does not already exist, since ECR
+// (unlike Docker Hub) requires the repository to exist before a push.
+func createECRRepo(login Login, repo string) error {
+	svc, err := ecrClient(login)
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.CreateRepository(&ecr.CreateRepositoryInput{
+		RepositoryName: aws.String(repo),
+	})
+	if err != nil {
+		if awsErr, ok := err.(interface{ Code() string }); ok && awsErr.Code() == ecr.ErrCodeRepositoryAlreadyExistsException {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// startECRTokenRefresher re-authenticates against ECR on a fixed interval
+// so a long-running batch of tag/push operations doesn't fail partway
+// through when the initial token expires. Callers stop it by closing the
+// returned channel once the plugin run completes.
+func startECRTokenRefresher(login Login) chan struct{} {
+	stop := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(ecrTokenRefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				refreshed, err := ecrLogin(login)
+				if err != nil {
+					fmt.Printf("Could not refresh ECR token: %s\n", err)
+					continue
+				}
+				cmd, err := commandLogin(refreshed)
+				if err != nil {
+					fmt.Printf("Could not re-authenticate to ECR: %s\n", err)
+					continue
+				}
+				if err := cmd.Run(); err != nil {
+					fmt.Printf("Could not re-authenticate to ECR: %s\n", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return stop
+}
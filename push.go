@@ -0,0 +1,228 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultParallelism is how many tags are pushed concurrently when
+// Plugin.Parallelism is unset.
+const defaultParallelism = 4
+
+// defaultRetryBackoff is the base delay between retries when
+// Plugin.RetryBackoff is unset.
+const defaultRetryBackoff = time.Second
+
+// transientPushErrors are substrings of docker CLI output that indicate a
+// retryable registry hiccup rather than a permanent failure.
+var transientPushErrors = []string{
+	"500 Internal Server Error",
+	"502 Bad Gateway",
+	"503 Service Unavailable",
+	"504 Gateway Timeout",
+	"TOOMANYREQUESTS",
+	"connection reset by peer",
+	"i/o timeout",
+	"Client.Timeout exceeded",
+}
+
+// permanentPushErrors are substrings that should never be retried, even if
+// they also happen to match a transient pattern.
+var permanentPushErrors = []string{
+	"unauthorized",
+	"authentication required",
+	"manifest unknown",
+	"requested access to the resource is denied",
+}
+
+// pushTagsConcurrently pushes every tag across a bounded worker pool,
+// retrying transient registry errors with exponential backoff. Each
+// worker's output is buffered and flushed in tag order once every push
+// has finished, so concurrent pushes don't interleave their logs.
+func (p Plugin) pushTagsConcurrently(tags []string) error {
+	parallelism := p.parallelism()
+	sem := make(chan struct{}, parallelism)
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(tags))
+	outs := make([]bytes.Buffer, len(tags))
+
+	for i, tag := range tags {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, tag string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := p.pushTagWithRetry(tag, &outs[i])
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %s", tag, err)
+			}
+		}(i, tag)
+	}
+	wg.Wait()
+
+	for i, tag := range tags {
+		fmt.Fprintf(os.Stdout, "+ %s\n", strings.Join(commandPush(p.Pull, tag, p.Daemon.Registry).Args, " "))
+		outs[i].WriteTo(os.Stdout)
+	}
+
+	var failures []string
+	for _, err := range errs {
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("Error pushing tags:\n%s", strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+// pushTagWithRetry pushes tag, retrying on a transient error up to
+// Plugin.MaxRetries times with exponentially increasing backoff.
+func (p Plugin) pushTagWithRetry(tag string, out *bytes.Buffer) error {
+	backoff := p.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= p.MaxRetries; attempt++ {
+		cmd := commandPush(p.Pull, tag, p.Daemon.Registry)
+		var attemptOut bytes.Buffer
+		cmd.Stdout = &attemptOut
+		cmd.Stderr = &attemptOut
+
+		err := cmd.Run()
+		output := attemptOut.String()
+		attemptOut.WriteTo(out)
+		if err == nil {
+			return nil
+		}
+
+		lastErr = err
+		if !isTransientPushError(output) || attempt == p.MaxRetries {
+			return lastErr
+		}
+		time.Sleep(backoff * time.Duration(1<<uint(attempt)))
+	}
+	return lastErr
+}
+
+// pushTagsConcurrentlyClient is the Engine API equivalent of
+// pushTagsConcurrently: it tags and pushes every tag across the same
+// bounded worker pool with the same retry-with-backoff policy, and returns
+// the digest the registry assigned each successfully pushed tag so callers
+// don't have to re-resolve it via the CLI.
+func (p Plugin) pushTagsConcurrentlyClient(ctx context.Context, cli Client, source string) (map[string]string, error) {
+	tags := p.Tags
+	parallelism := p.parallelism()
+	sem := make(chan struct{}, parallelism)
+
+	var wg sync.WaitGroup
+	var logMu sync.Mutex
+	errs := make([]error, len(tags))
+	digests := make([]string, len(tags))
+
+	for i, tag := range tags {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, tag string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			target := fmt.Sprintf("%s/%s:%s", p.Daemon.Registry, p.Pull.Repo, tag)
+			if err := cli.Tag(ctx, source, target); err != nil {
+				errs[i] = fmt.Errorf("%s: tagging: %s", tag, err)
+				return
+			}
+
+			digest, err := p.pushClientTagWithRetry(ctx, cli, target)
+
+			logMu.Lock()
+			fmt.Fprintf(os.Stdout, "+ push %s\n", target)
+			logMu.Unlock()
+
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %s", tag, err)
+				return
+			}
+			digests[i] = digest
+		}(i, tag)
+	}
+	wg.Wait()
+
+	result := make(map[string]string, len(tags))
+	var failures []string
+	for i, tag := range tags {
+		if errs[i] != nil {
+			failures = append(failures, errs[i].Error())
+			continue
+		}
+		if digests[i] != "" {
+			result[tag] = digests[i]
+		}
+	}
+	if len(failures) > 0 {
+		return result, fmt.Errorf("Error pushing tags:\n%s", strings.Join(failures, "\n"))
+	}
+	return result, nil
+}
+
+// pushClientTagWithRetry pushes target via the Engine API, retrying on a
+// transient error up to Plugin.MaxRetries times with exponentially
+// increasing backoff.
+func (p Plugin) pushClientTagWithRetry(ctx context.Context, cli Client, target string) (string, error) {
+	backoff := p.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= p.MaxRetries; attempt++ {
+		digest, err := cli.Push(ctx, target)
+		if err == nil {
+			return digest, nil
+		}
+
+		lastErr = err
+		if !isTransientPushError(err.Error()) || attempt == p.MaxRetries {
+			return "", lastErr
+		}
+		time.Sleep(backoff * time.Duration(1<<uint(attempt)))
+	}
+	return "", lastErr
+}
+
+// isTransientPushError reports whether push output looks like a transient
+// registry error worth retrying, as opposed to a permanent auth or
+// manifest failure.
+func isTransientPushError(output string) bool {
+	for _, marker := range permanentPushErrors {
+		if strings.Contains(output, marker) {
+			return false
+		}
+	}
+	for _, marker := range transientPushErrors {
+		if strings.Contains(output, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// parallelism returns the configured push concurrency, or defaultParallelism.
+func (p Plugin) parallelism() int {
+	if p.Parallelism > 0 {
+		return p.Parallelism
+	}
+	return defaultParallelism
+}